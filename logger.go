@@ -0,0 +1,29 @@
+package roadrunner
+
+// Logger is a minimal, leveled logging interface accepted by NewSocketFactory (WithLogger),
+// NewPipeFactory (WithPipeLogger) and NewPool (WithPoolLogger) so operators can plug in
+// whichever logging library they already run, rather than being stuck with roadrunner silently
+// dropping errors. NewWorker takes no logger. kv is a flat list of alternating keys and values,
+// following the convention popularised by hclog.
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+}
+
+// NopLogger discards every log event. It is the default logger when no logger option is
+// given, preserving today's silent behaviour for callers that don't opt in.
+type NopLogger struct{}
+
+// Debug does nothing.
+func (NopLogger) Debug(msg string, kv ...interface{}) {}
+
+// Info does nothing.
+func (NopLogger) Info(msg string, kv ...interface{}) {}
+
+// Warn does nothing.
+func (NopLogger) Warn(msg string, kv ...interface{}) {}
+
+// Error does nothing.
+func (NopLogger) Error(msg string, kv ...interface{}) {}
@@ -0,0 +1,25 @@
+package roadrunner
+
+import "github.com/hashicorp/go-hclog"
+
+// HCLogAdapter adapts an hclog.Logger to the roadrunner Logger interface.
+type HCLogAdapter struct {
+	Log hclog.Logger
+}
+
+// NewHCLogAdapter wraps l so it can be passed to WithLogger.
+func NewHCLogAdapter(l hclog.Logger) *HCLogAdapter {
+	return &HCLogAdapter{Log: l}
+}
+
+// Debug proxies to the wrapped hclog.Logger.
+func (a *HCLogAdapter) Debug(msg string, kv ...interface{}) { a.Log.Debug(msg, kv...) }
+
+// Info proxies to the wrapped hclog.Logger.
+func (a *HCLogAdapter) Info(msg string, kv ...interface{}) { a.Log.Info(msg, kv...) }
+
+// Warn proxies to the wrapped hclog.Logger.
+func (a *HCLogAdapter) Warn(msg string, kv ...interface{}) { a.Log.Warn(msg, kv...) }
+
+// Error proxies to the wrapped hclog.Logger.
+func (a *HCLogAdapter) Error(msg string, kv ...interface{}) { a.Log.Error(msg, kv...) }
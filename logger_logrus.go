@@ -0,0 +1,41 @@
+package roadrunner
+
+import "github.com/sirupsen/logrus"
+
+// LogrusAdapter adapts a logrus.FieldLogger to the roadrunner Logger interface, pairing up kv
+// arguments into logrus fields.
+type LogrusAdapter struct {
+	Log logrus.FieldLogger
+}
+
+// NewLogrusAdapter wraps l so it can be passed to WithLogger.
+func NewLogrusAdapter(l logrus.FieldLogger) *LogrusAdapter {
+	return &LogrusAdapter{Log: l}
+}
+
+// Debug proxies to the wrapped logrus.FieldLogger.
+func (a *LogrusAdapter) Debug(msg string, kv ...interface{}) { a.Log.WithFields(kvFields(kv)).Debug(msg) }
+
+// Info proxies to the wrapped logrus.FieldLogger.
+func (a *LogrusAdapter) Info(msg string, kv ...interface{}) { a.Log.WithFields(kvFields(kv)).Info(msg) }
+
+// Warn proxies to the wrapped logrus.FieldLogger.
+func (a *LogrusAdapter) Warn(msg string, kv ...interface{}) { a.Log.WithFields(kvFields(kv)).Warn(msg) }
+
+// Error proxies to the wrapped logrus.FieldLogger.
+func (a *LogrusAdapter) Error(msg string, kv ...interface{}) { a.Log.WithFields(kvFields(kv)).Error(msg) }
+
+// kvFields pairs up a flat kv slice ("key", value, "key", value, ...) into logrus.Fields,
+// dropping a trailing unpaired key.
+func kvFields(kv []interface{}) logrus.Fields {
+	fields := make(logrus.Fields, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			continue
+		}
+		fields[key] = kv[i+1]
+	}
+
+	return fields
+}
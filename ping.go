@@ -0,0 +1,67 @@
+package roadrunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spiral/goridge"
+)
+
+// PingCommand is the control frame used to verify a worker's relay is still responsive. The
+// worker is expected to echo it back unchanged.
+type PingCommand struct {
+	Pid int
+}
+
+// ping sends a PingCommand over rl and waits for the worker to echo it back, bounded by ctx. It
+// is run once right after a worker's relay attaches, both when a worker is first spawned and
+// when Pool.Reload brings up a replacement generation, so a worker that completed the handshake
+// but is already wedged isn't trusted with traffic.
+func ping(ctx context.Context, rl goridge.Relay, pid int) error {
+	if err := sendCommand(rl, PingCommand{Pid: pid}); err != nil {
+		return err
+	}
+
+	type result struct {
+		resp *PingCommand
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		body, p, err := rl.Receive()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+
+		if !p.HasFlag(goridge.PayloadControl) {
+			done <- result{err: fmt.Errorf("unexpected response, `control` header is missing from ping")}
+			return
+		}
+
+		resp := &PingCommand{}
+		if err := json.Unmarshal(body, resp); err != nil {
+			done <- result{err: err}
+			return
+		}
+
+		done <- result{resp: resp}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return r.err
+		}
+
+		if r.resp.Pid != pid {
+			return fmt.Errorf("integrity error, ping pid does not match handshake pid")
+		}
+
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,133 @@
+package roadrunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync/atomic"
+	"time"
+
+	"github.com/spiral/goridge"
+)
+
+// PipeFactory connects to a worker over its own stdin/stdout pipes rather than a shared socket
+// listener. Like SocketFactory it tracks a worker generation so Pool.Reload can spawn a
+// replacement batch of pipe workers while the outgoing generation drains; since each pipe is
+// exclusive to the worker that owns it, PipeFactory needs none of SocketFactory's relay-to-
+// generation bookkeeping to get this right.
+type PipeFactory struct {
+	tout time.Duration // handshake timeout
+	log  Logger        // receives factory lifecycle events, defaults to NopLogger
+	gen  uint64        // current worker generation, bumped by NewGeneration
+}
+
+// PipeOption configures optional PipeFactory behaviour, applied by NewPipeFactory.
+type PipeOption func(f *PipeFactory)
+
+// WithPipeLogger reports factory lifecycle events to log instead of the default NopLogger.
+func WithPipeLogger(log Logger) PipeOption {
+	return func(f *PipeFactory) {
+		f.log = log
+	}
+}
+
+// NewPipeFactory returns a PipeFactory that waits up to tout for a spawned worker to complete
+// its handshake over its own stdin/stdout pipes.
+func NewPipeFactory(tout time.Duration, options ...PipeOption) *PipeFactory {
+	f := &PipeFactory{
+		tout: tout,
+		log:  NopLogger{},
+	}
+
+	for _, opt := range options {
+		opt(f)
+	}
+
+	return f
+}
+
+// NewWorker creates worker and connects it to its own stdin/stdout relay, or returns an error.
+func (f *PipeFactory) NewWorker(cmd *exec.Cmd) (*Worker, error) {
+	return f.NewWorkerContext(context.Background(), cmd)
+}
+
+// NewWorkerContext is like NewWorker but honours ctx while starting cmd and completing the
+// handshake over its pipes.
+func (f *PipeFactory) NewWorkerContext(ctx context.Context, cmd *exec.Cmd) (*Worker, error) {
+	return f.newWorkerContext(ctx, f.currentGeneration(), cmd)
+}
+
+// currentGeneration returns the generation new workers are currently associated with.
+func (f *PipeFactory) currentGeneration() uint64 {
+	return atomic.LoadUint64(&f.gen)
+}
+
+// NewGeneration advances the factory to a new worker generation and returns its id, mirroring
+// SocketFactory.NewGeneration so Pool.Reload can treat either factory interchangeably.
+func (f *PipeFactory) NewGeneration() uint64 {
+	return atomic.AddUint64(&f.gen, 1)
+}
+
+// Close releases nothing: PipeFactory holds no shared descriptors, each worker's pipes belong
+// to that worker.
+func (f *PipeFactory) Close() error {
+	return nil
+}
+
+// newWorkerContext starts cmd, wires its pipes into a goridge relay and waits for it to complete
+// the handshake, honouring ctx at every blocking step. gen is only used for logging here:
+// PipeFactory has no shared accept loop that needs it to disambiguate which spawn a relay
+// belongs to, unlike SocketFactory.
+func (f *PipeFactory) newWorkerContext(ctx context.Context, gen uint64, cmd *exec.Cmd) (w *Worker, err error) {
+	w, err = NewWorker(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	in, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	hsCtx, cancel := context.WithTimeout(ctx, f.tout)
+	defer cancel()
+
+	if err := startCmdContext(hsCtx, w); err != nil {
+		return nil, err
+	}
+
+	rl := goridge.NewPipeRelay(in, out)
+
+	pid, err := fetchPIDContext(hsCtx, rl)
+	if err != nil {
+		w.cmd.Process.Kill()
+		return nil, fmt.Errorf("can't connect to worker %s: %s", w, err)
+	}
+
+	info, herr := hello(hsCtx, rl, pid)
+	switch {
+	case errors.Is(herr, errHelloUnsupported):
+		f.log.Debug("worker does not support hello handshake, skipping capability negotiation", "generation", gen, "pid", pid)
+	case herr != nil:
+		f.log.Warn("hello exchange failed", "generation", gen, "pid", pid, "error", herr)
+	}
+
+	if err := ping(hsCtx, rl, pid); err != nil {
+		w.cmd.Process.Kill()
+		return nil, fmt.Errorf("worker %s failed health ping: %s", w, err)
+	}
+
+	f.log.Info("worker pid assigned", "generation", gen, "pid", pid, "protocol", info.Protocol)
+
+	w.Pid = &pid
+	w.Info = info
+	w.attach(rl)
+
+	return w, nil
+}
@@ -0,0 +1,167 @@
+package roadrunner
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+)
+
+// reloadableFactory is the subset of SocketFactory/PipeFactory behaviour Pool depends on:
+// spawning a worker under a specific generation so Reload can bring up a replacement batch
+// without disturbing the generation that is currently serving requests.
+type reloadableFactory interface {
+	NewGeneration() uint64
+	newWorkerContext(ctx context.Context, gen uint64, cmd *exec.Cmd) (*Worker, error)
+	Close() error
+}
+
+// Pool manages a set of workers built from cmd via factory, and exposes Reload to replace the
+// whole set with a freshly spawned generation while the outgoing generation keeps serving
+// whatever it is already running.
+type Pool struct {
+	cmd     func() *exec.Cmd
+	factory reloadableFactory
+	log     Logger
+
+	mu    sync.Mutex
+	ready []*Worker // workers available for allocation, all belonging to gen
+	gen   uint64    // generation currently served by ready
+}
+
+// PoolOption configures optional Pool behaviour, applied by NewPool before workers are spawned.
+type PoolOption func(p *Pool)
+
+// WithPoolLogger reports pool allocation, return and reload events to log instead of the
+// default NopLogger.
+func WithPoolLogger(log Logger) PoolOption {
+	return func(p *Pool) {
+		p.log = log
+	}
+}
+
+// NewPool spawns numWorkers workers built from cmd via factory and returns the Pool managing
+// them. Pass WithPoolLogger to observe allocation, return and reload events.
+func NewPool(ctx context.Context, cmd func() *exec.Cmd, factory reloadableFactory, numWorkers int, options ...PoolOption) (*Pool, error) {
+	p := &Pool{
+		cmd:     cmd,
+		factory: factory,
+		log:     NopLogger{},
+	}
+
+	for _, opt := range options {
+		opt(p)
+	}
+
+	gen := factory.NewGeneration()
+	workers, err := p.spawnGeneration(ctx, gen, numWorkers)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.ready = workers
+	p.gen = gen
+	p.mu.Unlock()
+
+	return p, nil
+}
+
+// Workers returns the active generation's workers that are ready for allocation; workers handed
+// out by Allocate and not yet released are not included.
+func (p *Pool) Workers() []*Worker {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make([]*Worker, len(p.ready))
+	copy(out, p.ready)
+	return out
+}
+
+// Reload spawns a fresh generation of workers, one per worker the pool is currently running,
+// waits for each to complete its relay handshake and a health ping, then atomically swaps them
+// into the pool in place of the outgoing generation. It is the caller's responsibility to stop
+// routing new jobs to the returned outgoing workers and to signal them to stop once they finish
+// draining whatever they are already running. If any new worker fails to come up before ctx is
+// done, Reload kills the new workers it already started, leaves the existing pool untouched, and
+// returns an error.
+func (p *Pool) Reload(ctx context.Context) (outgoing []*Worker, err error) {
+	numWorkers := len(p.Workers())
+	gen := p.factory.NewGeneration()
+
+	fresh, err := p.spawnGeneration(ctx, gen, numWorkers)
+	if err != nil {
+		return nil, fmt.Errorf("reload aborted: %s", err)
+	}
+
+	p.mu.Lock()
+	outgoing = p.ready
+	p.ready = fresh
+	p.gen = gen
+	p.mu.Unlock()
+
+	p.log.Info("pool reloaded", "generation", gen, "workers", len(fresh))
+	return outgoing, nil
+}
+
+// spawnGeneration starts numWorkers workers under gen, one at a time, killing whatever it
+// already started and returning early if any of them fails to come up (including failing its
+// post-attach health ping) before ctx is done.
+func (p *Pool) spawnGeneration(ctx context.Context, gen uint64, numWorkers int) (workers []*Worker, err error) {
+	workers = make([]*Worker, 0, numWorkers)
+
+	killAll := func() {
+		for _, w := range workers {
+			if w.cmd.Process != nil {
+				w.cmd.Process.Kill()
+			}
+		}
+	}
+
+	for i := 0; i < numWorkers; i++ {
+		w, err := p.factory.newWorkerContext(ctx, gen, p.cmd())
+		if err != nil {
+			killAll()
+			return nil, err
+		}
+
+		p.log.Debug("worker joined generation", "generation", gen, "pid", *w.Pid)
+		workers = append(workers, w)
+	}
+
+	return workers, nil
+}
+
+// ErrPoolDrained is returned by Allocate when the pool has no ready worker to hand out.
+type ErrPoolDrained struct{}
+
+func (ErrPoolDrained) Error() string {
+	return "pool has no ready worker to allocate"
+}
+
+// Allocate removes and returns a ready worker for the caller to dispatch a job to. The caller
+// must return it with Release once done, so it becomes available for the next allocation.
+func (p *Pool) Allocate() (*Worker, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.ready) == 0 {
+		return nil, ErrPoolDrained{}
+	}
+
+	w := p.ready[len(p.ready)-1]
+	p.ready = p.ready[:len(p.ready)-1]
+
+	p.log.Debug("pool worker allocated", "generation", p.gen, "pid", *w.Pid)
+	return w, nil
+}
+
+// Release returns w to the ready queue once the caller is done with it, making it available for
+// the next Allocate call.
+func (p *Pool) Release(w *Worker) {
+	p.mu.Lock()
+	p.ready = append(p.ready, w)
+	p.mu.Unlock()
+
+	p.log.Debug("pool worker returned", "generation", p.gen, "pid", *w.Pid)
+}
@@ -0,0 +1,172 @@
+package roadrunner
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+
+	"github.com/spiral/goridge"
+)
+
+// RelaySecretEnvVar is the environment variable injectSecretEnv sets on a spawned worker's
+// process, hex-encoded, so the worker can sign its handshake with the same secret the parent's
+// RelayAuthenticator verifies against.
+const RelaySecretEnvVar = "RR_RELAY_SECRET"
+
+// injectSecretEnv sets RelaySecretEnvVar on cmd to the hex encoding of secret, if secret is
+// non-nil. Authenticators that verify by other means (e.g. PeerCredAuthenticator) return a nil
+// Secret and leave cmd's environment untouched. cmd.Env is based off the parent's own
+// environment when nil rather than replacing it outright: *exec.Cmd treats a nil Env as
+// "inherit everything", so starting from an empty slice here would strip the worker of its
+// inherited environment instead of merely adding one variable to it.
+func injectSecretEnv(cmd *exec.Cmd, secret []byte) {
+	if secret == nil {
+		return
+	}
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+
+	cmd.Env = append(env, RelaySecretEnvVar+"="+hex.EncodeToString(secret))
+}
+
+// AuthCommand carries the nonce/signature exchange used to authenticate a relay once it has
+// completed the PID handshake in fetchPIDContext. It travels inside the same PayloadControl frame
+// goridge already uses for PidCommand.
+type AuthCommand struct {
+	// Nonce is generated by the parent and must be echoed back, signed, by the worker.
+	Nonce []byte
+
+	// Signature is the worker's proof of possession of the shared secret over
+	// {parent_pid, child_pid, nonce}. Left empty in the parent -> child frame.
+	Signature []byte
+}
+
+// ErrRelayAuth is returned when a relay fails RelayAuthenticator verification. listen() delivers
+// it to the waiting newWorkerContext call via the relay's (generation, pid) wait channel, so
+// SocketFactory.NewWorker surfaces it unwrapped and callers can distinguish an auth failure from
+// a plain attach timeout or protocol error.
+type ErrRelayAuth struct {
+	Reason string
+}
+
+func (e *ErrRelayAuth) Error() string {
+	return fmt.Sprintf("relay authentication failed: %s", e.Reason)
+}
+
+// RelayAuthenticator verifies that a relay connecting to SocketFactory's listener belongs to
+// a worker this process actually spawned, rather than an arbitrary local (or, over TCP,
+// remote) peer able to connect to the listener and replay the PID handshake.
+type RelayAuthenticator interface {
+	// Secret returns the value that should be exposed to a spawned worker's environment
+	// (e.g. via an RR_RELAY_SECRET env var on the *exec.Cmd) so it can sign its handshake.
+	// Implementations that authenticate by other means (e.g. SO_PEERCRED) may return nil.
+	Secret() []byte
+
+	// Verify inspects the relay's connection and the nonce/signature it returned and
+	// returns a non-nil error if the relay should not be trusted.
+	Verify(conn net.Conn, pid int, auth AuthCommand) error
+}
+
+// HMACAuthenticator authenticates workers that sign {parent_pid, child_pid, nonce} with a
+// secret shared over the environment. It is the default choice when the listener is a TCP
+// socket and workers may run on the same or another trusted host.
+type HMACAuthenticator struct {
+	secret []byte
+}
+
+// NewHMACAuthenticator returns a RelayAuthenticator backed by the given shared secret.
+func NewHMACAuthenticator(secret []byte) *HMACAuthenticator {
+	return &HMACAuthenticator{secret: secret}
+}
+
+// Secret returns the shared secret to be passed to spawned workers.
+func (a *HMACAuthenticator) Secret() []byte {
+	return a.secret
+}
+
+// Verify recomputes the expected signature over {parent_pid, child_pid, nonce} and compares
+// it against the one the worker attached to the handshake.
+func (a *HMACAuthenticator) Verify(conn net.Conn, pid int, auth AuthCommand) error {
+	mac := hmac.New(sha256.New, a.secret)
+	fmt.Fprintf(mac, "%d:%d:%x", os.Getpid(), pid, auth.Nonce)
+
+	if !hmac.Equal(mac.Sum(nil), auth.Signature) {
+		return &ErrRelayAuth{Reason: "hmac signature mismatch"}
+	}
+
+	return nil
+}
+
+// newNonce returns a fresh random nonce for a single handshake attempt.
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return nonce, nil
+}
+
+// authenticate runs the nonce/signature exchange over rl and verifies it with auth. It is
+// invoked by listen() right after the PID handshake succeeds, before the relay is handed to a
+// waiting worker. ctx bounds the response receive, so a peer that completes the PID handshake
+// but never replies to the nonce (maliciously, or simply wedged) cannot block the whole accept
+// loop forever.
+func authenticate(ctx context.Context, rl goridge.Relay, conn net.Conn, pid int, auth RelayAuthenticator) error {
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+
+	if err := sendCommand(rl, AuthCommand{Nonce: nonce}); err != nil {
+		return err
+	}
+
+	type result struct {
+		resp *AuthCommand
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		body, p, err := rl.Receive()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+
+		if !p.HasFlag(goridge.PayloadControl) {
+			done <- result{err: &ErrRelayAuth{Reason: "control header is missing from auth response"}}
+			return
+		}
+
+		resp := &AuthCommand{}
+		if err := json.Unmarshal(body, resp); err != nil {
+			done <- result{err: err}
+			return
+		}
+
+		done <- result{resp: resp}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return r.err
+		}
+
+		return auth.Verify(conn, pid, *r.resp)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,69 @@
+package roadrunner
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// PeerCredAuthenticator authenticates workers connecting over a Unix domain socket by
+// checking the kernel-verified SO_PEERCRED credentials of the connection instead of relying
+// on anything the worker itself claims. It is the preferred authenticator when the listener
+// is a Unix socket, since it cannot be spoofed by another local process.
+type PeerCredAuthenticator struct {
+	// UID restricts accepted connections to a specific effective uid. Zero (root) is
+	// permitted explicitly; leave unset (nil) to accept the current process' own uid.
+	UID *uint32
+}
+
+// NewPeerCredAuthenticator returns a RelayAuthenticator that verifies workers by their Unix
+// socket peer credentials, restricting connections to the given uid.
+func NewPeerCredAuthenticator(uid uint32) *PeerCredAuthenticator {
+	return &PeerCredAuthenticator{UID: &uid}
+}
+
+// Secret is unused by PeerCredAuthenticator; credentials are read from the kernel, not signed
+// by the worker.
+func (a *PeerCredAuthenticator) Secret() []byte {
+	return nil
+}
+
+// Verify checks the SO_PEERCRED uid and pid of conn against the expected worker.
+func (a *PeerCredAuthenticator) Verify(conn net.Conn, pid int, auth AuthCommand) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return &ErrRelayAuth{Reason: "SO_PEERCRED authentication requires a unix socket relay"}
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return &ErrRelayAuth{Reason: fmt.Sprintf("can't obtain raw conn: %s", err)}
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return &ErrRelayAuth{Reason: fmt.Sprintf("can't read SO_PEERCRED: %s", err)}
+	}
+	if credErr != nil {
+		return &ErrRelayAuth{Reason: fmt.Sprintf("can't read SO_PEERCRED: %s", credErr)}
+	}
+
+	if int(cred.Pid) != pid {
+		return &ErrRelayAuth{Reason: fmt.Sprintf("peer pid %d does not match handshake pid %d", cred.Pid, pid)}
+	}
+
+	wantUID := uint32(os.Getuid())
+	if a.UID != nil {
+		wantUID = *a.UID
+	}
+
+	if cred.Uid != wantUID {
+		return &ErrRelayAuth{Reason: fmt.Sprintf("peer uid %d is not permitted", cred.Uid)}
+	}
+
+	return nil
+}
@@ -1,31 +1,112 @@
 package roadrunner
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/spiral/goridge"
 	"net"
 	"os"
 	"os/exec"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// SocketFactory connects to external workers using socket server.
+// SocketFactory connects to external workers using socket server. It keeps its net.Listener
+// open across worker generations so that Pool.Reload can spawn a replacement batch of
+// workers while the outgoing generation keeps serving already assigned jobs.
 type SocketFactory struct {
-	ls   net.Listener                      // listens for incoming connections from underlying processes
-	tout time.Duration                     // connection timeout
-	mu   sync.Mutex                        // protects socket mapping
-	wait map[int]chan *goridge.SocketRelay // sockets which are waiting for process association
+	ls     net.Listener                       // listens for incoming connections from underlying processes
+	tout   time.Duration                      // connection timeout
+	auth   RelayAuthenticator                 // verifies a relay belongs to a worker this process spawned, if set
+	log    Logger                             // receives factory lifecycle events, defaults to NopLogger
+	proto  *ProtocolRange                     // supported worker protocol versions, nil accepts any
+	mu     sync.Mutex                         // protects socket mapping
+	gen    uint64                             // current worker generation, bumped by NewGeneration
+	pidGen map[int]uint64                     // generation each in-flight spawn registered itself under, keyed by pid
+	wait   map[relayKey]chan *handshakeResult // sockets which are waiting for process association
+}
+
+// relayHandshake is what listen() hands off to a blocked waitRelayContext call once a worker
+// has completed the PID handshake (and, when configured, authentication and the hello
+// exchange).
+type relayHandshake struct {
+	rl   *goridge.SocketRelay
+	info WorkerInfo
+}
+
+// handshakeResult is what listen() actually sends a waiting waitRelayContext call: either a
+// relayHandshake for a worker that completed the full handshake, or the error that made listen()
+// reject it. Carrying the error lets the caller distinguish an auth failure or a protocol
+// mismatch from a plain attach timeout, instead of every rejection collapsing into the same
+// generic "relay timer for [pid]" message.
+type handshakeResult struct {
+	hs  *relayHandshake
+	err error
+}
+
+// Option configures optional SocketFactory behaviour, applied by NewSocketFactory before the
+// accept loop starts.
+type Option func(f *SocketFactory)
+
+// WithAuthenticator rejects any relay whose handshake does not pass auth. Without an
+// authenticator, any process able to connect to the listener and complete the PID handshake
+// is trusted, which is unsafe when the listener is a TCP socket reachable by other users.
+func WithAuthenticator(auth RelayAuthenticator) Option {
+	return func(f *SocketFactory) {
+		f.auth = auth
+	}
+}
+
+// WithTLS wraps the factory's listener in TLS using cfg, so that workers connecting from
+// another host do so over an encrypted, authenticated channel.
+func WithTLS(cfg *tls.Config) Option {
+	return func(f *SocketFactory) {
+		f.ls = tls.NewListener(f.ls, cfg)
+	}
+}
+
+// WithLogger reports factory lifecycle events (relay accepts, handshake failures, worker
+// PID assignment, attach timeouts) to log instead of the default NopLogger.
+func WithLogger(log Logger) Option {
+	return func(f *SocketFactory) {
+		f.log = log
+	}
+}
+
+// WithProtocolRange rejects any worker whose declared hello protocol version falls outside r.
+// Without this option, any protocol version a worker reports is accepted.
+func WithProtocolRange(r ProtocolRange) Option {
+	return func(f *SocketFactory) {
+		f.proto = &r
+	}
+}
+
+// relayKey identifies a pending relay by worker generation and pid. Keying on generation as
+// well as pid keeps a reload's incoming workers from ever being confused with an outgoing
+// worker, even if the OS has already reused its pid.
+type relayKey struct {
+	gen uint64
+	pid int
 }
 
 // NewSocketFactory returns SocketFactory attached to a given socket listener. tout specifies for how long factory
-// should wait for incoming relay connection
-func NewSocketFactory(ls net.Listener, tout time.Duration) *SocketFactory {
+// should wait for incoming relay connection. Pass WithAuthenticator and/or WithTLS to
+// authenticate and encrypt the relay connections, and WithLogger to observe factory events.
+func NewSocketFactory(ls net.Listener, tout time.Duration, options ...Option) *SocketFactory {
 	f := &SocketFactory{
-		ls:   ls,
-		tout: tout,
-		wait: make(map[int]chan *goridge.SocketRelay),
+		ls:     ls,
+		tout:   tout,
+		log:    NopLogger{},
+		pidGen: make(map[int]uint64),
+		wait:   make(map[relayKey]chan *handshakeResult),
+	}
+
+	for _, opt := range options {
+		opt(f)
 	}
 
 	go f.listen()
@@ -34,12 +115,31 @@ func NewSocketFactory(ls net.Listener, tout time.Duration) *SocketFactory {
 
 // NewWorker creates worker and connects it to appropriate relay or returns error
 func (f *SocketFactory) NewWorker(cmd *exec.Cmd) (w *Worker, err error) {
+	return f.NewWorkerContext(context.Background(), cmd)
+}
+
+// NewWorkerContext is like NewWorker but honours ctx at every blocking step: starting cmd,
+// reading its pid and waiting for its relay to attach. If ctx is cancelled, a process that
+// already started is killed and any relay it eventually presents is discarded rather than
+// left associated with a worker nobody is waiting for.
+func (f *SocketFactory) NewWorkerContext(ctx context.Context, cmd *exec.Cmd) (w *Worker, err error) {
+	return f.newWorkerContext(ctx, f.currentGeneration(), cmd)
+}
+
+// newWorkerContext starts cmd and waits for it to associate with a relay belonging to gen. It
+// is the shared implementation behind NewWorkerContext and the per-generation spawning
+// Pool.Reload does when bringing up a replacement batch of workers.
+func (f *SocketFactory) newWorkerContext(ctx context.Context, gen uint64, cmd *exec.Cmd) (w *Worker, err error) {
 	w, err = NewWorker(cmd)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := w.Start(); err != nil {
+	if f.auth != nil {
+		injectSecretEnv(cmd, f.auth.Secret())
+	}
+
+	if err := startCmdContext(ctx, w); err != nil {
 		return nil, err
 	}
 
@@ -48,16 +148,65 @@ func (f *SocketFactory) NewWorker(cmd *exec.Cmd) (w *Worker, err error) {
 		return nil, fmt.Errorf("can't to start worker %s", w)
 	}
 
-	rl, err := f.waitRelay(*w.Pid, f.tout)
+	hs, err := f.waitRelayContext(ctx, gen, *w.Pid, f.tout)
+	var authErr *ErrRelayAuth
+	var protoErr *ErrProtocolMismatch
+	if errors.As(err, &authErr) || errors.As(err, &protoErr) {
+		w.cmd.Process.Kill()
+		return nil, err
+	}
 	if err != nil {
+		w.cmd.Process.Kill()
 		return nil, fmt.Errorf("can't connect to worker %s: %s", w, err)
 	}
 
-	w.attach(rl)
+	if err := ping(ctx, hs.rl, *w.Pid); err != nil {
+		hs.rl.Close()
+		w.cmd.Process.Kill()
+		return nil, fmt.Errorf("worker %s failed health ping: %s", w, err)
+	}
+
+	w.Info = hs.info
+	w.attach(hs.rl)
 
 	return w, nil
 }
 
+// startCmdContext starts w, returning early if ctx is cancelled before the start completes. A
+// start that completes after ctx was already given up on is killed in the background so the
+// process doesn't leak. Shared between SocketFactory and PipeFactory, whose newWorkerContext
+// implementations are otherwise independent.
+func startCmdContext(ctx context.Context, w *Worker) error {
+	done := make(chan error, 1)
+	go func() { done <- w.Start() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		go func() {
+			if err := <-done; err == nil && w.cmd.Process != nil {
+				w.cmd.Process.Kill()
+			}
+		}()
+
+		return ctx.Err()
+	}
+}
+
+// currentGeneration returns the generation new workers are currently associated with.
+func (f *SocketFactory) currentGeneration() uint64 {
+	return atomic.LoadUint64(&f.gen)
+}
+
+// NewGeneration advances the factory to a new worker generation and returns its id. Pool.Reload
+// calls this before spawning the replacement batch of workers, then passes the returned id to
+// newWorkerContext so the incoming generation's relays can't collide with the outgoing one, even
+// while both are alive at once.
+func (f *SocketFactory) NewGeneration() uint64 {
+	return atomic.AddUint64(&f.gen, 1)
+}
+
 // Close closes all open factory descriptors.
 func (f *SocketFactory) Close() error {
 	return f.ls.Close()
@@ -71,68 +220,235 @@ func (f *SocketFactory) listen() {
 			return
 		}
 
+		f.log.Debug("relay accept", "remote", conn.RemoteAddr())
+
+		// hsCtx bounds the whole handshake attempt for this connection - the PID exchange, the
+		// auth round trip and the hello exchange all share the one deadline, rather than each
+		// getting its own fresh f.tout window. A peer that stalls at any step is cut off at the
+		// same overall attempt deadline NewWorkerContext's caller would expect, instead of being
+		// able to string together up to three separate timeouts before being rejected.
+		hsCtx, cancel := context.WithTimeout(context.Background(), f.tout)
+
 		rl := goridge.NewSocketRelay(conn)
-		if pid, err := fetchPID(rl); err == nil {
-			f.relayChan(pid) <- rl
+		pid, err := fetchPIDContext(hsCtx, rl)
+		if err != nil {
+			f.log.Warn("handshake failed", "remote", conn.RemoteAddr(), "error", err)
+			conn.Close()
+			cancel()
+			continue
+		}
+
+		// pid is known from here on, so any rejection below is delivered to whichever
+		// newWorkerContext call is waiting on it instead of merely being logged: the caller
+		// gets the typed reason (ErrRelayAuth, ErrProtocolMismatch) rather than a generic
+		// "relay timer for [pid]" once its own timeout eventually fires.
+		gen := f.generationFor(pid)
+
+		if f.auth != nil {
+			if err := authenticate(hsCtx, rl, conn, pid, f.auth); err != nil {
+				f.log.Warn("relay authentication failed", "remote", conn.RemoteAddr(), "pid", pid, "error", err)
+				conn.Close()
+				f.deliver(gen, pid, &handshakeResult{err: err})
+				cancel()
+				continue
+			}
+		}
+
+		info, err := hello(hsCtx, rl, pid)
+		cancel()
+		switch {
+		case errors.Is(err, errHelloUnsupported) && f.proto != nil:
+			// A ProtocolRange is configured, so an ambiguous non-response can't be told apart
+			// from a worker deliberately built against an incompatible protocol: admitting it
+			// would defeat WithProtocolRange for any worker that simply stays quiet past the
+			// deadline. Fail closed instead.
+			f.log.Warn("worker did not send hello before the deadline, rejecting under configured protocol range", "remote", conn.RemoteAddr(), "pid", pid, "supported", f.proto.String())
+			conn.Close()
+			f.deliver(gen, pid, &handshakeResult{err: err})
+			continue
+		case errors.Is(err, errHelloUnsupported):
+			// Plain worker that never sends a hello frame: keep it, just without the extra
+			// metadata. Rejecting it outright would wedge every pre-hello worker on a factory
+			// that has since been upgraded to expect one.
+			f.log.Debug("worker does not support hello handshake, skipping capability negotiation", "pid", pid)
+		case err != nil:
+			f.log.Warn("hello exchange failed", "remote", conn.RemoteAddr(), "pid", pid, "error", err)
+			conn.Close()
+			f.deliver(gen, pid, &handshakeResult{err: err})
+			continue
+		case f.proto != nil && !f.proto.Contains(info.Protocol):
+			mismatch := &ErrProtocolMismatch{Pid: pid, Protocol: info.Protocol, Range: *f.proto}
+			f.log.Warn("worker protocol rejected", "pid", pid, "protocol", info.Protocol, "supported", f.proto.String())
+			conn.Close()
+			f.deliver(gen, pid, &handshakeResult{err: mismatch})
+			continue
 		}
+
+		f.log.Info("worker pid assigned", "pid", pid, "protocol", info.Protocol, "capabilities", info.Capabilities)
+
+		// File the relay under the generation its spawn registered itself with, not whatever
+		// generation happens to be current by the time the connection lands. During a reload
+		// two generations are briefly in flight at once; currentGeneration() can have already
+		// moved on while this pid's waiter is still blocked on the generation it started under.
+		f.deliver(gen, pid, &handshakeResult{hs: &relayHandshake{rl: rl, info: info}})
+	}
+}
+
+// deliver sends res to whichever waitRelayContext call is blocked on (gen, pid), if any. Unlike
+// the former always-delivers-on-success path, rejections (auth failure, protocol mismatch) are
+// now delivered too, including to a caller that already gave up and is no longer receiving; the
+// send is therefore bounded by f.tout rather than risking wedging the accept loop forever.
+func (f *SocketFactory) deliver(gen uint64, pid int, res *handshakeResult) {
+	ch := f.relayChan(gen, pid)
+
+	select {
+	case ch <- res:
+	default:
+		go func() {
+			select {
+			case ch <- res:
+			case <-time.After(f.tout):
+			}
+		}()
 	}
 }
 
-// waits for worker to connect over socket and returns associated relay of timeout
-func (f *SocketFactory) waitRelay(pid int, tout time.Duration) (*goridge.SocketRelay, error) {
+// waits for worker to connect over socket and returns associated relay, or an error on
+// timeout, ctx cancellation, or a typed rejection (auth failure, protocol mismatch) delivered by
+// listen(). Either way, f.wait is left clean: on timeout or cancellation, abandon takes over
+// responsibility for closing a relay that shows up afterwards.
+func (f *SocketFactory) waitRelayContext(ctx context.Context, gen uint64, pid int, tout time.Duration) (*relayHandshake, error) {
+	ch := f.relayChan(gen, pid)
 	timer := time.NewTimer(tout)
+	defer timer.Stop()
+
 	select {
-	case rl := <-f.relayChan(pid):
-		timer.Stop()
-		f.cleanChan(pid)
+	case res := <-ch:
+		f.cleanChan(gen, pid)
+		if res.err != nil {
+			return nil, res.err
+		}
 
-		return rl, nil
+		return res.hs, nil
 	case <-timer.C:
+		f.log.Warn("worker attach timeout", "pid", pid, "timeout", tout)
+		f.abandon(gen, pid, ch)
 		return nil, fmt.Errorf("relay timer for [%v]", pid)
+	case <-ctx.Done():
+		f.log.Warn("worker attach cancelled", "pid", pid)
+		f.abandon(gen, pid, ch)
+		return nil, ctx.Err()
 	}
 }
 
-// chan to store relay associated with specific Pid
-func (f *SocketFactory) relayChan(pid int) chan *goridge.SocketRelay {
+// abandon takes over an in-flight relay wait that the caller of waitRelayContext gave up on.
+// If a relay connects (or a rejection arrives) afterwards, its channel send would otherwise
+// either block listen() forever (an unbuffered send with no receiver) or, if we'd deleted the
+// map entry instead, get assigned a fresh channel that sits in f.wait unread forever. abandon
+// avoids both by keeping the original channel reachable until it either receives a late result,
+// whose relay (if any) it closes, or the wait window elapses.
+func (f *SocketFactory) abandon(gen uint64, pid int, ch chan *handshakeResult) {
+	go func() {
+		select {
+		case res := <-ch:
+			if res != nil && res.hs != nil {
+				res.hs.rl.Close()
+			}
+		case <-time.After(f.tout):
+		}
+
+		f.cleanChan(gen, pid)
+	}()
+}
+
+// chan to store relay associated with specific generation and Pid. The first call for a given
+// (gen, pid) pair also registers gen as the generation that pid's spawn is waiting under, so
+// listen can recover it later via generationFor.
+func (f *SocketFactory) relayChan(gen uint64, pid int) chan *handshakeResult {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	rl, ok := f.wait[pid]
+	key := relayKey{gen: gen, pid: pid}
+	rl, ok := f.wait[key]
 	if !ok {
-		f.wait[pid] = make(chan *goridge.SocketRelay)
-		return f.wait[pid]
+		rl = make(chan *handshakeResult)
+		f.wait[key] = rl
+		f.pidGen[pid] = gen
 	}
 
 	return rl
 }
 
-// deletes relay chan associated with specific Pid
-func (f *SocketFactory) cleanChan(pid int) {
+// deletes relay chan associated with specific generation and Pid, along with the pidGen entry
+// relayChan registered for it.
+func (f *SocketFactory) cleanChan(gen uint64, pid int) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	delete(f.wait, pid)
+	delete(f.wait, relayKey{gen: gen, pid: pid})
+	delete(f.pidGen, pid)
 }
 
-// send control command to relay and return associated Pid (or error)
-func fetchPID(rl goridge.Relay) (pid int, err error) {
-	if err := sendCommand(rl, PidCommand{Pid: os.Getpid()}); err != nil {
-		return 0, err
-	}
+// generationFor returns the generation pid's in-flight spawn registered itself under, so listen
+// can file an incoming relay at the same key its waiter is blocked on. Falls back to the current
+// generation for a pid nothing registered, e.g. a relay that reconnects after its waiter already
+// gave up and was cleaned up.
+func (f *SocketFactory) generationFor(pid int) uint64 {
+	f.mu.Lock()
+	gen, ok := f.pidGen[pid]
+	f.mu.Unlock()
 
-	body, p, err := rl.Receive()
-	if !p.HasFlag(goridge.PayloadControl) {
-		return 0, fmt.Errorf("unexpected response, `control` header is missing")
+	if ok {
+		return gen
 	}
 
-	link := &PidCommand{}
-	if err := json.Unmarshal(body, link); err != nil {
+	return f.currentGeneration()
+}
+
+// send control command to relay and return associated Pid (or error). ctx bounds the initial
+// receive, so a peer that completes the PID handshake but never replies (malicious or simply
+// wedged) cannot block the caller forever.
+func fetchPIDContext(ctx context.Context, rl goridge.Relay) (pid int, err error) {
+	if err := sendCommand(rl, PidCommand{Pid: os.Getpid()}); err != nil {
 		return 0, err
 	}
 
-	if link.Parent != os.Getpid() {
-		return 0, fmt.Errorf("integrity error, parent process does not match")
+	type result struct {
+		pid int
+		err error
 	}
 
-	return link.Pid, nil
-}
\ No newline at end of file
+	done := make(chan result, 1)
+	go func() {
+		body, p, err := rl.Receive()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+
+		if !p.HasFlag(goridge.PayloadControl) {
+			done <- result{err: fmt.Errorf("unexpected response, `control` header is missing")}
+			return
+		}
+
+		link := &PidCommand{}
+		if err := json.Unmarshal(body, link); err != nil {
+			done <- result{err: err}
+			return
+		}
+
+		if link.Parent != os.Getpid() {
+			done <- result{err: fmt.Errorf("integrity error, parent process does not match")}
+			return
+		}
+
+		done <- result{pid: link.Pid}
+	}()
+
+	select {
+	case r := <-done:
+		return r.pid, r.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
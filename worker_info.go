@@ -0,0 +1,144 @@
+package roadrunner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spiral/goridge"
+)
+
+// WorkerInfo captures the metadata a worker reports about itself during the hello handshake,
+// beyond the bare PID fetchPIDContext already exchanges. SocketFactory.NewWorker attaches it to the
+// returned Worker as Worker.Info.
+type WorkerInfo struct {
+	// Version is the semantic version of the worker script, e.g. "1.4.0".
+	Version string
+
+	// Protocol is the control protocol version the worker implements.
+	Protocol int
+
+	// Capabilities lists the services this worker declares it can handle, e.g. "http",
+	// "jobs", "grpc". A future multi-capability pool can use this to route jobs only to
+	// workers that advertised the matching capability.
+	Capabilities []string
+
+	// Hostname identifies the host the worker is running on, useful once workers can be
+	// spread across machines behind a TCP SocketFactory.
+	Hostname string
+
+	// Labels are free-form operator supplied metadata, not interpreted by roadrunner itself.
+	Labels map[string]string
+}
+
+// HasCapability reports whether the worker declared cap among its capabilities.
+func (i WorkerInfo) HasCapability(cap string) bool {
+	for _, c := range i.Capabilities {
+		if c == cap {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HelloCommand is the control frame a worker sends describing itself, received right after
+// the PID handshake in fetchPIDContext.
+type HelloCommand struct {
+	Pid          int
+	Version      string
+	Protocol     int
+	Capabilities []string
+	Hostname     string
+	Labels       map[string]string
+}
+
+// ProtocolRange restricts which worker protocol versions SocketFactory will accept, so that a
+// parent can reject workers built against an incompatible control protocol instead of
+// misbehaving against them.
+type ProtocolRange struct {
+	Min int
+	Max int
+}
+
+// Contains reports whether v falls within the range, inclusive.
+func (r ProtocolRange) Contains(v int) bool {
+	return v >= r.Min && v <= r.Max
+}
+
+func (r ProtocolRange) String() string {
+	return fmt.Sprintf("[%d, %d]", r.Min, r.Max)
+}
+
+// ErrProtocolMismatch is returned when a worker's declared protocol version falls outside the
+// factory's configured ProtocolRange.
+type ErrProtocolMismatch struct {
+	Pid      int
+	Protocol int
+	Range    ProtocolRange
+}
+
+func (e *ErrProtocolMismatch) Error() string {
+	return fmt.Sprintf("worker %v declared protocol %d, outside supported range %s", e.Pid, e.Protocol, e.Range)
+}
+
+// errHelloUnsupported is returned by hello when ctx runs out before the worker sends a
+// HelloCommand. A worker that never sends one can't be told apart from a worker that is merely
+// slow, so listen() only falls back to an empty WorkerInfo for it when no ProtocolRange is
+// configured; with WithProtocolRange set, the ambiguity is resolved by rejecting the connection
+// instead of silently admitting a worker whose protocol was never actually checked.
+var errHelloUnsupported = errors.New("worker did not send a hello frame before the deadline")
+
+// hello receives the worker's HelloCommand from rl and returns its reported info; nothing is sent
+// to the worker first. It runs right
+// after the PID handshake (and authentication, if configured) succeeds, before the relay is
+// handed off to a waiting worker. ctx bounds the receive: hello is a negotiated capability, not
+// a mandatory part of the handshake, so a worker that never sends one (rather than sending a
+// malformed one) must not block the caller past ctx's deadline.
+func hello(ctx context.Context, rl goridge.Relay, pid int) (WorkerInfo, error) {
+	type result struct {
+		info WorkerInfo
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		body, p, err := rl.Receive()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+
+		if !p.HasFlag(goridge.PayloadControl) {
+			done <- result{err: fmt.Errorf("unexpected response, `control` header is missing from hello")}
+			return
+		}
+
+		link := &HelloCommand{}
+		if err := json.Unmarshal(body, link); err != nil {
+			done <- result{err: err}
+			return
+		}
+
+		if link.Pid != pid {
+			done <- result{err: fmt.Errorf("integrity error, hello pid does not match handshake pid")}
+			return
+		}
+
+		done <- result{info: WorkerInfo{
+			Version:      link.Version,
+			Protocol:     link.Protocol,
+			Capabilities: link.Capabilities,
+			Hostname:     link.Hostname,
+			Labels:       link.Labels,
+		}}
+	}()
+
+	select {
+	case r := <-done:
+		return r.info, r.err
+	case <-ctx.Done():
+		return WorkerInfo{}, errHelloUnsupported
+	}
+}